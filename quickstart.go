@@ -3,44 +3,135 @@
 // Usage examples:
 //  go run quickstart.go lookup --asset W12-1234 --base http://localhost:8000 --token "Bearer ey..."
 //  go run quickstart.go prefetch --session 42 --base http://localhost:8000 --token "Bearer ey..."
+//  go run quickstart.go login --oidc-issuer https://auth.example.com --oidc-client-id rtutils-cli
 // Flags:
 //  --base    Base URL of the running RTUtils server (default http://localhost:8000)
 //  --token   Authorization header value (e.g. "Token abc..." or "Bearer ...")
 //  --cookie  Raw Cookie header to send (e.g. "sessionid=...; csrftoken=...")
 //  --insecure  Skip TLS verification (useful for self-signed certs)
+//  --client-cert, --client-key, --ca-cert  mTLS client authentication
+//  --cert-fingerprint  Pin the server certificate's SHA-256 fingerprint
+//
+// When no --token/--cookie is given, lookup/prefetch fall back to the cached
+// OIDC tokens written by the `login` subcommand (refreshing them first if
+// they are close to expiry). See loadCachedToken/setAuth. When mTLS client
+// credentials are configured, the server is expected to authenticate the
+// peer certificate instead, so no Authorization header is sent unless
+// --token is given explicitly.
 
 package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/zalando/go-keyring"
+	"gopkg.in/yaml.v3"
+	"nhooyr.io/websocket"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintln(os.Stderr, "expected 'lookup' or 'prefetch' subcommands")
+		fmt.Fprintln(os.Stderr, "expected 'lookup', 'prefetch', 'login', 'logout', 'credential-plugin', 'gen-cert', or 'profile' subcommands")
 		os.Exit(2)
 	}
 
-	// Default from environment when available
-	defaultBase := os.Getenv("RTUTILS_BASE")
+	// --config/--profile pick which config.yaml profile supplies defaults,
+	// layered below RTUTILS_* env vars and above the hardcoded fallback.
+	// Explicit flags on the subcommand always win, same as before profiles
+	// existed: flag > env var > profile > hardcoded default.
+	configPath := os.Getenv("RTUTILS_CONFIG")
+	profileName := os.Getenv("RTUTILS_PROFILE")
+	for i, a := range os.Args[1:] {
+		if a == "--config" && i+2 < len(os.Args) {
+			configPath = os.Args[i+2]
+		} else if strings.HasPrefix(a, "--config=") {
+			configPath = strings.TrimPrefix(a, "--config=")
+		} else if a == "--profile" && i+2 < len(os.Args) {
+			profileName = os.Args[i+2]
+		} else if strings.HasPrefix(a, "--profile=") {
+			profileName = strings.TrimPrefix(a, "--profile=")
+		}
+	}
+	cfg, err := loadConfig(resolveConfigPath(configPath))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: failed to load config file:", err)
+		cfg = &rtutilsConfig{}
+	}
+	if profileName == "" {
+		profileName = cfg.DefaultProfile
+	}
+	var prof profileConfig
+	if profileName != "" {
+		if p, ok := cfg.Profiles[profileName]; ok {
+			prof = p
+		} else {
+			fmt.Fprintln(os.Stderr, "warning: profile not found in config:", profileName)
+		}
+	}
+
+	// Default from profile, then environment when available
+	defaultBase := prof.Base
 	if defaultBase == "" {
 		defaultBase = "http://localhost:8000"
 	}
-	defaultToken := os.Getenv("RTUTILS_TOKEN")
+	if v := os.Getenv("RTUTILS_BASE"); v != "" {
+		defaultBase = v
+	}
+	defaultToken := envOr("RTUTILS_TOKEN", "")
+	defaultIssuer := envOr("RTUTILS_OIDC_ISSUER", prof.OIDCIssuer)
+	defaultClientID := envOr("RTUTILS_OIDC_CLIENT_ID", prof.OIDCClientID)
+	defaultScopes := envOr("RTUTILS_OIDC_SCOPES", prof.OIDCScopes)
+	if defaultScopes == "" {
+		defaultScopes = "openid profile offline_access"
+	}
+	defaultClientCert := envOr("RTUTILS_CLIENT_CERT", prof.ClientCert)
+	defaultClientKey := envOr("RTUTILS_CLIENT_KEY", prof.ClientKey)
+	defaultCACert := envOr("RTUTILS_CLIENT_CA", prof.CACert)
+	defaultAuthScheme := envOr("RTUTILS_AUTH_SCHEME", prof.AuthScheme)
+	if defaultAuthScheme == "" {
+		defaultAuthScheme = "Token"
+	}
+	if defaultToken == "" && profileName != "" {
+		if tok, err := ensureFreshProfileToken(profileName); err == nil {
+			// OIDC sessions are always bearer tokens regardless of the
+			// profile's auth_scheme, which only applies to static tokens.
+			defaultToken = "Bearer " + tok
+		}
+	}
+	defaultHeaders := prof.Headers
 
 	base := flag.String("base", defaultBase, "Base URL of RTUtils server")
 	token := flag.String("token", defaultToken, "Authorization header value (e.g. 'Token ...' or 'Bearer ...')")
 	cookie := flag.String("cookie", "", "Raw Cookie header to send")
-	insecure := flag.Bool("insecure", false, "Skip TLS certificate verification")
+	authScheme := flag.String("auth-scheme", defaultAuthScheme, "Authorization scheme to prefix --token with when it has no explicit scheme")
+	insecure := flag.Bool("insecure", prof.Insecure, "Skip TLS certificate verification")
+	clientCert := flag.String("client-cert", defaultClientCert, "Path to a client certificate for mTLS (PEM)")
+	clientKey := flag.String("client-key", defaultClientKey, "Path to the client certificate's private key (PEM)")
+	caCert := flag.String("ca-cert", defaultCACert, "Path to a CA bundle to verify the server against (PEM)")
+	certFingerprint := flag.String("cert-fingerprint", prof.CertFingerprint, "Pin the server certificate's SHA-256 fingerprint (hex, colon or plain)")
+	flag.String("config", configPath, "Path to the rtutils config.yaml (default $XDG_CONFIG_HOME/rtutils/config.yaml)")
+	flag.String("profile", profileName, "Named profile from the config file to use as defaults")
 	// Parse common flags only for now; subcommands will use flag package again
 	flag.CommandLine.Parse([]string{})
 
@@ -53,7 +144,14 @@ func main() {
 		lookupCmd.StringVar(base, "base", *base, "Base URL of RTUtils server")
 		lookupCmd.StringVar(token, "token", *token, "Authorization header value")
 		lookupCmd.StringVar(cookie, "cookie", *cookie, "Raw Cookie header to send")
+		lookupCmd.StringVar(authScheme, "auth-scheme", *authScheme, "Authorization scheme to prefix --token with")
 		lookupCmd.BoolVar(insecure, "insecure", *insecure, "Skip TLS verification")
+		lookupCmd.StringVar(clientCert, "client-cert", *clientCert, "Path to a client certificate for mTLS (PEM)")
+		lookupCmd.StringVar(clientKey, "client-key", *clientKey, "Path to the client certificate's private key (PEM)")
+		lookupCmd.StringVar(caCert, "ca-cert", *caCert, "Path to a CA bundle to verify the server against (PEM)")
+		lookupCmd.StringVar(certFingerprint, "cert-fingerprint", *certFingerprint, "Pin the server certificate's SHA-256 fingerprint")
+		lookupCmd.String("config", configPath, "Path to the rtutils config.yaml")
+		lookupCmd.String("profile", profileName, "Named profile from the config file to use as defaults")
 		lookupCmd.Parse(os.Args[2:])
 
 		if *asset == "" {
@@ -62,10 +160,15 @@ func main() {
 			os.Exit(2)
 		}
 
-		client := makeClient(*insecure)
+		client, err := makeClient(*insecure, *clientCert, *clientKey, *caCert, *certFingerprint)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "tls setup error:", err)
+			os.Exit(1)
+		}
 		url := strings.TrimRight(*base, "/") + "/devices/audit/api/lookup-device/" + *asset + "/"
 		req, _ := http.NewRequest("GET", url, nil)
-		setAuth(req, *token, *cookie)
+		applyDefaultHeaders(req, defaultHeaders)
+		setAuth(req, *token, *cookie, *authScheme, *clientCert != "" && *clientKey != "")
 		fmt.Println("GET", url)
 		resp, err := client.Do(req)
 		if err != nil {
@@ -83,7 +186,15 @@ func main() {
 		pfCmd.StringVar(base, "base", *base, "Base URL of RTUtils server")
 		pfCmd.StringVar(token, "token", *token, "Authorization header value")
 		pfCmd.StringVar(cookie, "cookie", *cookie, "Raw Cookie header to send")
+		pfCmd.StringVar(authScheme, "auth-scheme", *authScheme, "Authorization scheme to prefix --token with")
 		pfCmd.BoolVar(insecure, "insecure", *insecure, "Skip TLS verification")
+		pfCmd.StringVar(clientCert, "client-cert", *clientCert, "Path to a client certificate for mTLS (PEM)")
+		pfCmd.StringVar(clientKey, "client-key", *clientKey, "Path to the client certificate's private key (PEM)")
+		pfCmd.StringVar(caCert, "ca-cert", *caCert, "Path to a CA bundle to verify the server against (PEM)")
+		pfCmd.StringVar(certFingerprint, "cert-fingerprint", *certFingerprint, "Pin the server certificate's SHA-256 fingerprint")
+		stream := pfCmd.Bool("stream", true, "Stream status over WebSocket instead of polling; falls back to polling if the server doesn't support it")
+		pfCmd.String("config", configPath, "Path to the rtutils config.yaml")
+		pfCmd.String("profile", profileName, "Named profile from the config file to use as defaults")
 		pfCmd.Parse(os.Args[2:])
 
 		if *session == "" {
@@ -92,10 +203,15 @@ func main() {
 			os.Exit(2)
 		}
 
-		client := makeClient(*insecure)
+		client, err := makeClient(*insecure, *clientCert, *clientKey, *caCert, *certFingerprint)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "tls setup error:", err)
+			os.Exit(1)
+		}
 		url := strings.TrimRight(*base, "/") + "/devices/audit/api/prefetch-devices-async/" + *session + "/"
 		req, _ := http.NewRequest("POST", url, bytes.NewBuffer([]byte("{}")))
-		setAuth(req, *token, *cookie)
+		applyDefaultHeaders(req, defaultHeaders)
+		setAuth(req, *token, *cookie, *authScheme, *clientCert != "" && *clientKey != "")
 		req.Header.Set("Content-Type", "application/json")
 		fmt.Println("POST", url)
 		resp, err := client.Do(req)
@@ -108,41 +224,174 @@ func main() {
 		printResponse(resp.StatusCode, body)
 
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 && *poll {
+			mtlsActive := *clientCert != "" && *clientKey != ""
 			// try to parse job_id or status_url
 			var m map[string]interface{}
 			if err := json.Unmarshal(body, &m); err == nil {
+				jobID, _ := m["job_id"].(string)
 				statusURL := ""
 				if s, ok := m["status_url"].(string); ok && s != "" {
 					statusURL = s
-				} else if job, ok := m["job_id"].(string); ok && job != "" {
-					statusURL = strings.TrimRight(*base, "/") + "/devices/audit/api/prefetch-status/" + job + "/"
+				} else if jobID != "" {
+					statusURL = strings.TrimRight(*base, "/") + "/devices/audit/api/prefetch-status/" + jobID + "/"
 				}
-				if statusURL != "" {
-					pollStatus(client, statusURL, *token, *cookie)
-				} else {
-					fmt.Fprintln(os.Stderr, "no status_url or job_id returned; cannot poll")
+
+				streamed := false
+				if *stream && jobID != "" {
+					var err error
+					streamed, err = streamPrefetch(client, *base, jobID, *token, *cookie, *authScheme, mtlsActive, defaultHeaders)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, "stream error, falling back to polling:", err)
+					}
+				}
+
+				if !streamed {
+					if statusURL != "" {
+						pollStatus(client, statusURL, *token, *cookie, *authScheme, mtlsActive, defaultHeaders)
+					} else {
+						fmt.Fprintln(os.Stderr, "no status_url or job_id returned; cannot poll")
+					}
 				}
 			}
 		}
 
+	case "login":
+		loginCmd := flag.NewFlagSet("login", flag.ExitOnError)
+		issuer := loginCmd.String("oidc-issuer", defaultIssuer, "OIDC issuer URL (e.g. https://auth.example.com)")
+		clientID := loginCmd.String("oidc-client-id", defaultClientID, "OIDC client ID")
+		scopes := loginCmd.String("oidc-scopes", defaultScopes, "Space-separated OIDC scopes to request")
+		loginCmd.String("config", configPath, "Path to the rtutils config.yaml")
+		loginCmd.String("profile", profileName, "Named profile to source OIDC defaults from")
+		loginCmd.Parse(os.Args[2:])
+
+		if *issuer == "" || *clientID == "" {
+			fmt.Fprintln(os.Stderr, "--oidc-issuer and --oidc-client-id are required (or RTUTILS_OIDC_ISSUER / RTUTILS_OIDC_CLIENT_ID)")
+			os.Exit(2)
+		}
+
+		if err := runLogin(*issuer, *clientID, *scopes); err != nil {
+			fmt.Fprintln(os.Stderr, "login failed:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Login successful; tokens cached at", tokenCachePath())
+
+	case "logout":
+		logoutCmd := flag.NewFlagSet("logout", flag.ExitOnError)
+		logoutCmd.String("config", configPath, "Path to the rtutils config.yaml")
+		logoutCmd.String("profile", profileName, "Named profile to source OIDC defaults from")
+		logoutCmd.Parse(os.Args[2:])
+
+		if err := runLogout(); err != nil {
+			fmt.Fprintln(os.Stderr, "logout failed:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Logged out; cached tokens removed")
+
+	case "credential-plugin":
+		cpCmd := flag.NewFlagSet("credential-plugin", flag.ExitOnError)
+		issuer := cpCmd.String("oidc-issuer", defaultIssuer, "OIDC issuer URL, used only if no valid cached session exists")
+		clientID := cpCmd.String("oidc-client-id", defaultClientID, "OIDC client ID, used only if no valid cached session exists")
+		scopes := cpCmd.String("oidc-scopes", defaultScopes, "Space-separated OIDC scopes, used only if no valid cached session exists")
+		cpCmd.String("config", configPath, "Path to the rtutils config.yaml")
+		cpCmd.String("profile", profileName, "Named profile to source OIDC defaults from")
+		cpCmd.Parse(os.Args[2:])
+
+		cred, err := buildExecCredential(*issuer, *clientID, *scopes)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "credential-plugin failed:", err)
+			os.Exit(1)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(cred); err != nil {
+			fmt.Fprintln(os.Stderr, "encoding ExecCredential:", err)
+			os.Exit(1)
+		}
+
+	case "gen-cert":
+		genCertCmd := flag.NewFlagSet("gen-cert", flag.ExitOnError)
+		commonName := genCertCmd.String("common-name", "", "Subject CN for the CSR, typically the agent's hostname (required)")
+		keyOut := genCertCmd.String("out-key", "client.key", "Path to write the generated private key")
+		csrOut := genCertCmd.String("out-csr", "client.csr", "Path to write the generated CSR")
+		bits := genCertCmd.Int("bits", 2048, "RSA key size in bits")
+		genCertCmd.String("config", configPath, "Path to the rtutils config.yaml")
+		genCertCmd.String("profile", profileName, "Named profile (unused, accepted for flag consistency)")
+		genCertCmd.Parse(os.Args[2:])
+
+		if *commonName == "" {
+			fmt.Fprintln(os.Stderr, "--common-name is required")
+			genCertCmd.Usage()
+			os.Exit(2)
+		}
+
+		if err := genCert(*commonName, *keyOut, *csrOut, *bits); err != nil {
+			fmt.Fprintln(os.Stderr, "gen-cert failed:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s and %s; send the CSR to your RTUtils admin to sign\n", *keyOut, *csrOut)
+
+	case "profile":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "expected 'add', 'list', 'remove', or 'use' after 'profile'")
+			os.Exit(2)
+		}
+		if err := runProfileCmd(resolveConfigPath(configPath), os.Args[2], os.Args[3:]); err != nil {
+			fmt.Fprintln(os.Stderr, "profile command failed:", err)
+			os.Exit(1)
+		}
+
 	default:
 		fmt.Fprintln(os.Stderr, "unknown subcommand:", sub)
 		os.Exit(2)
 	}
 }
 
-func setAuth(req *http.Request, token, cookie string) {
+// genCert shells out to openssl to generate an RSA key pair and a CSR for
+// commonName, so operators have a repeatable way to enroll agents for mTLS
+// without the CLI itself needing to hold a CA key.
+func genCert(commonName, keyOut, csrOut string, bits int) error {
+	cmd := exec.Command("openssl", "req", "-new", "-newkey", fmt.Sprintf("rsa:%d", bits),
+		"-nodes", "-keyout", keyOut, "-out", csrOut, "-subj", "/CN="+commonName)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running openssl: %w", err)
+	}
+	return os.Chmod(keyOut, 0600)
+}
+
+// setAuth attaches credentials to req. When mtlsActive is true the server is
+// expected to authenticate the client certificate presented at the TLS
+// layer, so no Authorization header is sent unless a token was explicitly
+// provided.
+// setAuth attaches credentials to req. authScheme is the Authorization
+// scheme to prefix token with when token has no explicit scheme of its own
+// (i.e. doesn't already contain a space); it comes from --auth-scheme /
+// RTUTILS_AUTH_SCHEME / the active profile's auth_scheme, in that order,
+// and only applies to static tokens — cached OIDC sessions are always
+// tagged "Bearer" at the source since that's what the token endpoint issues.
+func setAuth(req *http.Request, token, cookie, authScheme string, mtlsActive bool) {
+	if token == "" && cookie == "" {
+		if mtlsActive {
+			return
+		}
+		if cached, err := loadCachedToken(); err == nil {
+			req.Header.Set("Authorization", "Bearer "+cached)
+			return
+		}
+		// No explicit credentials and no usable cache: proceed unauthenticated
+		// and let the server return 401/403.
+		return
+	}
 	if token != "" {
 		// If token already contains a scheme (contains space like "Token abc"), use as-is.
 		if strings.Contains(token, " ") {
 			req.Header.Set("Authorization", token)
 		} else {
-			// Allow overriding default scheme via RTUTILS_AUTH_SCHEME env var; default to "Token".
-			scheme := os.Getenv("RTUTILS_AUTH_SCHEME")
-			if scheme == "" {
-				scheme = "Token"
+			if authScheme == "" {
+				authScheme = "Token"
 			}
-			req.Header.Set("Authorization", scheme+" "+token)
+			req.Header.Set("Authorization", authScheme+" "+token)
 		}
 	}
 	if cookie != "" {
@@ -150,12 +399,888 @@ func setAuth(req *http.Request, token, cookie string) {
 	}
 }
 
-func makeClient(insecure bool) *http.Client {
+// applyDefaultHeaders sets each of a profile's default headers on req,
+// before any of Authorization/Cookie/Content-Type are applied, so explicit
+// per-request headers always take precedence over profile defaults.
+func applyDefaultHeaders(req *http.Request, headers map[string]string) {
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// tokenCache is the on-disk representation of a cached OIDC session,
+// written by `login` and consumed by setAuth/loadCachedToken.
+type tokenCache struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token,omitempty"`
+	ExpiresAt    int64  `json:"expires_at"` // unix seconds
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+}
+
+// oidcDiscovery holds the subset of the /.well-known/openid-configuration
+// document that the login flow and token refresh need.
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+}
+
+// tokenRefreshSkew is how far ahead of expiry a cached access token is
+// considered stale and eligible for refresh.
+const tokenRefreshSkew = 60 * time.Second
+
+func tokenCachePath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "rtutils", "tokens.json")
+}
+
+func loadTokenCache() (*tokenCache, error) {
+	data, err := os.ReadFile(tokenCachePath())
+	if err != nil {
+		return nil, err
+	}
+	var tc tokenCache
+	if err := json.Unmarshal(data, &tc); err != nil {
+		return nil, fmt.Errorf("parsing cached tokens: %w", err)
+	}
+	return &tc, nil
+}
+
+// saveTokenCache writes tc to disk atomically (write to a temp file in the
+// same directory, then rename) with mode 0600 so refresh-token rotation
+// never leaves a partially-written file behind.
+func saveTokenCache(tc *tokenCache) error {
+	path := tokenCachePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating token cache dir: %w", err)
+	}
+	data, err := json.MarshalIndent(tc, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tokens-*.json.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadCachedToken returns a usable access token, transparently refreshing it
+// against tc.Issuer's token endpoint when it is within tokenRefreshSkew of
+// expiring. The rotated refresh token (if any) is written back to disk.
+func loadCachedToken() (string, error) {
+	tc, err := ensureFreshTokenCache()
+	if err != nil {
+		return "", err
+	}
+	return tc.AccessToken, nil
+}
+
+// ensureFreshTokenCache loads the on-disk token cache and, if the access
+// token is within tokenRefreshSkew of expiring, refreshes it against the
+// issuer's token endpoint, persisting the rotated refresh token to disk.
+func ensureFreshTokenCache() (*tokenCache, error) {
+	tc, err := loadTokenCache()
+	if err != nil {
+		return nil, err
+	}
+	if time.Until(time.Unix(tc.ExpiresAt, 0)) > tokenRefreshSkew {
+		return tc, nil
+	}
+	if tc.RefreshToken == "" {
+		return nil, fmt.Errorf("cached token expired and no refresh_token available; run 'login' again")
+	}
+
+	disc, err := discoverOIDC(tc.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovering issuer for refresh: %w", err)
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tc.RefreshToken},
+		"client_id":     {tc.ClientID},
+	}
+	newTC, err := exchangeToken(disc.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("refreshing token: %w", err)
+	}
+	newTC.Issuer = tc.Issuer
+	newTC.ClientID = tc.ClientID
+	if newTC.RefreshToken == "" {
+		newTC.RefreshToken = tc.RefreshToken // server may not rotate it
+	}
+	if err := saveTokenCache(newTC); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: failed to persist refreshed token:", err)
+	}
+	return newTC, nil
+}
+
+func discoverOIDC(issuer string) (*oidcDiscovery, error) {
+	u := strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := http.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, u)
+	}
+	var disc oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&disc); err != nil {
+		return nil, fmt.Errorf("decoding discovery document: %w", err)
+	}
+	return &disc, nil
+}
+
+// exchangeToken POSTs form (already containing grant_type and friends) to
+// tokenEndpoint and normalizes the response into a tokenCache.
+func exchangeToken(tokenEndpoint string, form url.Values) (*tokenCache, error) {
+	resp, err := http.PostForm(tokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+	var raw struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("decoding token response: %w", err)
+	}
+	if raw.AccessToken == "" {
+		return nil, fmt.Errorf("token response missing access_token")
+	}
+	if raw.ExpiresIn == 0 {
+		raw.ExpiresIn = 3600
+	}
+	return &tokenCache{
+		AccessToken:  raw.AccessToken,
+		RefreshToken: raw.RefreshToken,
+		IDToken:      raw.IDToken,
+		ExpiresAt:    time.Now().Add(time.Duration(raw.ExpiresIn) * time.Second).Unix(),
+	}, nil
+}
+
+// execCredential is a client.authentication.k8s.io/v1beta1 ExecCredential,
+// the contract kubectl/helm exec-plugins use to source a bearer token.
+type execCredential struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Status     execCredentialStatus `json:"status"`
+}
+
+type execCredentialStatus struct {
+	Token               string `json:"token"`
+	ExpirationTimestamp string `json:"expirationTimestamp"`
+}
+
+const execCredentialSkew = 30 * time.Second
+
+// buildExecCredential produces the ExecCredential document for the
+// `credential-plugin` subcommand, reusing (and refreshing, or if necessary
+// renewing via a fresh login) the same cached OIDC session as lookup/prefetch.
+func buildExecCredential(issuer, clientID, scopes string) (*execCredential, error) {
+	tc, err := ensureAccessToken(issuer, clientID, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := time.Unix(tc.ExpiresAt, 0)
+	if exp, err := jwtExpiry(tc.AccessToken); err == nil {
+		expiry = exp
+	}
+	expiry = expiry.Add(-execCredentialSkew)
+
+	return &execCredential{
+		APIVersion: "client.authentication.k8s.io/v1beta1",
+		Kind:       "ExecCredential",
+		Status: execCredentialStatus{
+			Token:               tc.AccessToken,
+			ExpirationTimestamp: expiry.Format(time.RFC3339),
+		},
+	}, nil
+}
+
+// ensureAccessToken returns a non-expired cached token, refreshing it if
+// needed, or performs a fresh OIDC login if no cache exists. Before
+// launching a browser it honors KUBERNETES_EXEC_INFO's spec.interactive
+// flag, since exec-plugin invocations from automation are non-interactive
+// and must fail instead of hanging on a login prompt.
+func ensureAccessToken(issuer, clientID, scopes string) (*tokenCache, error) {
+	if tc, err := ensureFreshTokenCache(); err == nil {
+		return tc, nil
+	}
+
+	if interactive, set := execInfoInteractive(); set && !interactive {
+		return nil, fmt.Errorf("no valid cached credentials and KUBERNETES_EXEC_INFO reports a non-interactive session; run 'rtutils login' first")
+	}
+	if issuer == "" || clientID == "" {
+		return nil, fmt.Errorf("no valid cached credentials and --oidc-issuer/--oidc-client-id not set")
+	}
+	if err := runLogin(issuer, clientID, scopes); err != nil {
+		return nil, err
+	}
+	return loadTokenCache()
+}
+
+// execInfoInteractive parses KUBERNETES_EXEC_INFO's spec.interactive field.
+// The second return value is false when the env var is unset or the field
+// is absent, meaning the caller has no opinion and should assume interactive.
+func execInfoInteractive() (interactive bool, set bool) {
+	raw := os.Getenv("KUBERNETES_EXEC_INFO")
+	if raw == "" {
+		return false, false
+	}
+	var info struct {
+		Spec struct {
+			Interactive *bool `json:"interactive"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal([]byte(raw), &info); err != nil || info.Spec.Interactive == nil {
+		return false, false
+	}
+	return *info.Spec.Interactive, true
+}
+
+// jwtExpiry decodes the "exp" claim out of a JWT's payload segment, without
+// verifying its signature (the token has already been authenticated by the
+// OIDC issuer; this is only used to surface an accurate expiration time).
+func jwtExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("decoding JWT payload: %w", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("decoding JWT claims: %w", err)
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("JWT has no exp claim")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
+
+// profileConfig is one named environment in config.yaml: everything needed
+// to talk to an RTUtils deployment except secrets, which are never written
+// to the YAML file (see setProfileSecret).
+type profileConfig struct {
+	Base            string            `yaml:"base,omitempty"`
+	AuthScheme      string            `yaml:"auth_scheme,omitempty"`
+	OIDCIssuer      string            `yaml:"oidc_issuer,omitempty"`
+	OIDCClientID    string            `yaml:"oidc_client_id,omitempty"`
+	OIDCScopes      string            `yaml:"oidc_scopes,omitempty"`
+	ClientCert      string            `yaml:"client_cert,omitempty"`
+	ClientKey       string            `yaml:"client_key,omitempty"`
+	CACert          string            `yaml:"ca_cert,omitempty"`
+	CertFingerprint string            `yaml:"cert_fingerprint,omitempty"`
+	Insecure        bool              `yaml:"insecure,omitempty"`
+	Headers         map[string]string `yaml:"headers,omitempty"`
+}
+
+// rtutilsConfig is the root of ~/.config/rtutils/config.yaml.
+type rtutilsConfig struct {
+	DefaultProfile string                   `yaml:"default_profile,omitempty"`
+	Profiles       map[string]profileConfig `yaml:"profiles,omitempty"`
+}
+
+// headerFlagList collects repeated "-header 'Key: Value'" flags into a
+// map[string]string via toMap, for populating profileConfig.Headers.
+type headerFlagList []string
+
+func (h *headerFlagList) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlagList) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+func (h headerFlagList) toMap() (map[string]string, error) {
+	if len(h) == 0 {
+		return nil, nil
+	}
+	headers := make(map[string]string, len(h))
+	for _, entry := range h {
+		k, v, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid --header %q, expected 'Key: Value'", entry)
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return headers, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func resolveConfigPath(override string) string {
+	if override != "" {
+		return override
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "rtutils", "config.yaml")
+}
+
+func loadConfig(path string) (*rtutilsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &rtutilsConfig{Profiles: map[string]profileConfig{}}, nil
+		}
+		return nil, err
+	}
+	var cfg rtutilsConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]profileConfig{}
+	}
+	return &cfg, nil
+}
+
+func saveConfig(path string, cfg *rtutilsConfig) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating config dir: %w", err)
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// secretKind identifies one piece of profile-scoped secret material. These
+// are deliberately kept out of config.yaml; see setProfileSecret.
+type secretKind string
+
+const secretKindToken secretKind = "token" // JSON-encoded tokenCache
+
+const secretKeyringService = "rtutils"
+
+func profileSecretAccount(profile string, kind secretKind) string {
+	return profile + ":" + string(kind)
+}
+
+// secretFallbackPath is where a profile secret is written when no OS
+// keyring backend is available, e.g. a headless Linux box with no Secret
+// Service provider running.
+func secretFallbackPath(profile string, kind secretKind) string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "rtutils", "secrets", profile+"-"+string(kind)+".json")
+}
+
+// setProfileSecret stores value in the OS keyring (Keychain / Credential
+// Manager / Secret Service), falling back to a 0600 file with a warning
+// when no keyring backend is available.
+func setProfileSecret(profile string, kind secretKind, value string) error {
+	if err := keyring.Set(secretKeyringService, profileSecretAccount(profile, kind), value); err == nil {
+		return nil
+	}
+	path := secretFallbackPath(profile, kind)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "warning: no OS keyring available; storing secret in", path)
+	return os.WriteFile(path, []byte(value), 0600)
+}
+
+func getProfileSecret(profile string, kind secretKind) (string, error) {
+	if v, err := keyring.Get(secretKeyringService, profileSecretAccount(profile, kind)); err == nil {
+		return v, nil
+	}
+	data, err := os.ReadFile(secretFallbackPath(profile, kind))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func deleteProfileSecrets(profile string) {
+	_ = keyring.Delete(secretKeyringService, profileSecretAccount(profile, secretKindToken))
+	_ = os.Remove(secretFallbackPath(profile, secretKindToken))
+}
+
+func setProfileTokenCache(profile string, tc *tokenCache) error {
+	data, err := json.Marshal(tc)
+	if err != nil {
+		return err
+	}
+	return setProfileSecret(profile, secretKindToken, string(data))
+}
+
+// ensureFreshProfileToken returns a usable access token for profile's
+// cached OIDC session, refreshing it first if it is within tokenRefreshSkew
+// of expiring (mirroring ensureFreshTokenCache, but scoped to a profile's
+// keyring entry instead of the single global token cache file).
+func ensureFreshProfileToken(profile string) (string, error) {
+	raw, err := getProfileSecret(profile, secretKindToken)
+	if err != nil {
+		return "", err
+	}
+	var tc tokenCache
+	if err := json.Unmarshal([]byte(raw), &tc); err != nil {
+		return "", fmt.Errorf("parsing cached tokens for profile %s: %w", profile, err)
+	}
+	if time.Until(time.Unix(tc.ExpiresAt, 0)) > tokenRefreshSkew {
+		return tc.AccessToken, nil
+	}
+	if tc.RefreshToken == "" {
+		return "", fmt.Errorf("cached token for profile %s expired and has no refresh_token", profile)
+	}
+
+	disc, err := discoverOIDC(tc.Issuer)
+	if err != nil {
+		return "", fmt.Errorf("discovering issuer for refresh: %w", err)
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tc.RefreshToken},
+		"client_id":     {tc.ClientID},
+	}
+	newTC, err := exchangeToken(disc.TokenEndpoint, form)
+	if err != nil {
+		return "", fmt.Errorf("refreshing token: %w", err)
+	}
+	newTC.Issuer = tc.Issuer
+	newTC.ClientID = tc.ClientID
+	if newTC.RefreshToken == "" {
+		newTC.RefreshToken = tc.RefreshToken
+	}
+	if err := setProfileTokenCache(profile, newTC); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: failed to persist refreshed profile token:", err)
+	}
+	return newTC.AccessToken, nil
+}
+
+// runProfileCmd dispatches `rtutils profile <action> ...`.
+func runProfileCmd(configPath, action string, args []string) error {
+	switch action {
+	case "add":
+		return profileAdd(configPath, args)
+	case "list":
+		return profileList(configPath)
+	case "remove":
+		return profileRemove(configPath, args)
+	case "use":
+		return profileUse(configPath, args)
+	default:
+		return fmt.Errorf("unknown profile action %q (want add|list|remove|use)", action)
+	}
+}
+
+func profileAdd(configPath string, args []string) error {
+	fs := flag.NewFlagSet("profile add", flag.ExitOnError)
+	name := fs.String("name", "", "Profile name (required)")
+	base := fs.String("base", "", "Base URL of RTUtils server")
+	authScheme := fs.String("auth-scheme", "", "Default Authorization scheme (e.g. Token, Bearer)")
+	issuer := fs.String("oidc-issuer", "", "OIDC issuer URL")
+	clientID := fs.String("oidc-client-id", "", "OIDC client ID")
+	scopes := fs.String("oidc-scopes", "", "Space-separated OIDC scopes")
+	clientCert := fs.String("client-cert", "", "Path to a client certificate for mTLS (PEM)")
+	clientKey := fs.String("client-key", "", "Path to the client certificate's private key (PEM)")
+	caCert := fs.String("ca-cert", "", "Path to a CA bundle to verify the server against (PEM)")
+	certFingerprint := fs.String("cert-fingerprint", "", "Pin the server certificate's SHA-256 fingerprint")
+	insecure := fs.Bool("insecure", false, "Skip TLS certificate verification")
+	var headerFlags headerFlagList
+	fs.Var(&headerFlags, "header", "Default header to send as 'Key: Value' (may be repeated)")
+	doLogin := fs.Bool("login", false, "Run the OIDC login flow now and store the resulting tokens in this profile's keyring entry")
+	fs.Parse(args)
+
+	if *name == "" {
+		return fmt.Errorf("--name is required")
+	}
+	headers, err := headerFlags.toMap()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	cfg.Profiles[*name] = profileConfig{
+		Base:            *base,
+		AuthScheme:      *authScheme,
+		OIDCIssuer:      *issuer,
+		OIDCClientID:    *clientID,
+		OIDCScopes:      *scopes,
+		ClientCert:      *clientCert,
+		ClientKey:       *clientKey,
+		CACert:          *caCert,
+		CertFingerprint: *certFingerprint,
+		Insecure:        *insecure,
+		Headers:         headers,
+	}
+	if cfg.DefaultProfile == "" {
+		cfg.DefaultProfile = *name
+	}
+	if err := saveConfig(configPath, cfg); err != nil {
+		return err
+	}
+	fmt.Println("Profile saved:", *name)
+
+	if *doLogin {
+		if *issuer == "" || *clientID == "" {
+			return fmt.Errorf("--login requires --oidc-issuer and --oidc-client-id")
+		}
+		loginScopes := *scopes
+		if loginScopes == "" {
+			loginScopes = "openid profile offline_access"
+		}
+		if err := runLogin(*issuer, *clientID, loginScopes); err != nil {
+			return fmt.Errorf("login: %w", err)
+		}
+		tc, err := loadTokenCache()
+		if err != nil {
+			return fmt.Errorf("reading tokens after login: %w", err)
+		}
+		if err := setProfileTokenCache(*name, tc); err != nil {
+			return fmt.Errorf("storing tokens for profile %s: %w", *name, err)
+		}
+		fmt.Println("Stored OIDC tokens for profile", *name)
+	}
+	return nil
+}
+
+func profileList(configPath string) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Profiles) == 0 {
+		fmt.Println("(no profiles configured)")
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Profiles))
+	for n := range cfg.Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		p := cfg.Profiles[n]
+		marker := " "
+		if n == cfg.DefaultProfile {
+			marker = "*"
+		}
+		fmt.Printf("%s %-20s base=%s\n", marker, n, p.Base)
+	}
+	return nil
+}
+
+func profileRemove(configPath string, args []string) error {
+	fs := flag.NewFlagSet("profile remove", flag.ExitOnError)
+	nameFlag := fs.String("name", "", "Profile name (required)")
+	fs.Parse(args)
+	if *nameFlag == "" {
+		return fmt.Errorf("--name is required")
+	}
+	name := *nameFlag
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Profiles[name]; !ok {
+		return fmt.Errorf("no such profile: %s", name)
+	}
+	delete(cfg.Profiles, name)
+	if cfg.DefaultProfile == name {
+		cfg.DefaultProfile = ""
+	}
+	if err := saveConfig(configPath, cfg); err != nil {
+		return err
+	}
+	deleteProfileSecrets(name)
+	fmt.Println("Profile removed:", name)
+	return nil
+}
+
+func profileUse(configPath string, args []string) error {
+	fs := flag.NewFlagSet("profile use", flag.ExitOnError)
+	nameFlag := fs.String("name", "", "Profile name (required)")
+	fs.Parse(args)
+	if *nameFlag == "" {
+		return fmt.Errorf("--name is required")
+	}
+	name := *nameFlag
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Profiles[name]; !ok {
+		return fmt.Errorf("no such profile: %s", name)
+	}
+	cfg.DefaultProfile = name
+	if err := saveConfig(configPath, cfg); err != nil {
+		return err
+	}
+	fmt.Println("Default profile set to", name)
+	return nil
+}
+
+// generateCodeVerifier returns a cryptographically random 43-character
+// base64url string suitable for use as a PKCE code_verifier.
+func generateCodeVerifier() (string, error) {
+	b := make([]byte, 32) // 32 raw bytes -> 43 base64url chars, no padding
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func codeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func generateState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// openBrowser best-effort launches the user's default browser. Failure is
+// non-fatal: the URL is always printed so the user can open it manually.
+func openBrowser(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	return cmd.Start()
+}
+
+// runLogin performs the OAuth2 authorization-code flow with PKCE against
+// issuer: discover the endpoints, stand up a loopback redirect listener,
+// open the browser, wait for the callback, and exchange the code for
+// tokens which are cached to disk for subsequent lookup/prefetch calls.
+func runLogin(issuer, clientID, scopes string) error {
+	disc, err := discoverOIDC(issuer)
+	if err != nil {
+		return fmt.Errorf("discovering issuer: %w", err)
+	}
+
+	verifier, err := generateCodeVerifier()
+	if err != nil {
+		return fmt.Errorf("generating code_verifier: %w", err)
+	}
+	challenge := codeChallengeS256(verifier)
+	state, err := generateState()
+	if err != nil {
+		return fmt.Errorf("generating state: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("binding loopback redirect listener: %w", err)
+	}
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port)
+
+	type callbackResult struct {
+		code string
+		err  error
+	}
+	resultCh := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if errParam := q.Get("error"); errParam != "" {
+			resultCh <- callbackResult{err: fmt.Errorf("authorization server returned error: %s (%s)", errParam, q.Get("error_description"))}
+			fmt.Fprintln(w, "Login failed, you may close this tab.")
+			return
+		}
+		if q.Get("state") != state {
+			resultCh <- callbackResult{err: fmt.Errorf("state mismatch in callback")}
+			fmt.Fprintln(w, "Login failed (state mismatch), you may close this tab.")
+			return
+		}
+		resultCh <- callbackResult{code: q.Get("code")}
+		fmt.Fprintln(w, "Login successful, you may close this tab.")
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authURL := disc.AuthorizationEndpoint + "?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {scopes},
+		"state":                 {state},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+
+	fmt.Println("Opening browser for login:", authURL)
+	if err := openBrowser(authURL); err != nil {
+		fmt.Fprintln(os.Stderr, "could not open browser automatically, please open the URL above manually")
+	}
+
+	select {
+	case res := <-resultCh:
+		if res.err != nil {
+			return res.err
+		}
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {res.code},
+			"redirect_uri":  {redirectURI},
+			"client_id":     {clientID},
+			"code_verifier": {verifier},
+		}
+		tc, err := exchangeToken(disc.TokenEndpoint, form)
+		if err != nil {
+			return fmt.Errorf("exchanging code: %w", err)
+		}
+		tc.Issuer = issuer
+		tc.ClientID = clientID
+		return saveTokenCache(tc)
+	case <-time.After(5 * time.Minute):
+		return fmt.Errorf("timed out waiting for browser callback")
+	}
+}
+
+// runLogout revokes (best-effort) and deletes any cached OIDC tokens.
+func runLogout() error {
+	tc, err := loadTokenCache()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if tc.RefreshToken != "" {
+		if disc, err := discoverOIDC(tc.Issuer); err == nil && disc.RevocationEndpoint != "" {
+			form := url.Values{"token": {tc.RefreshToken}, "client_id": {tc.ClientID}}
+			if _, err := http.PostForm(disc.RevocationEndpoint, form); err != nil {
+				fmt.Fprintln(os.Stderr, "warning: failed to revoke refresh token:", err)
+			}
+		}
+	}
+	if err := os.Remove(tokenCachePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// makeClient builds the *http.Client used for all requests, wiring up
+// --insecure, mTLS client certificates, a custom CA bundle, and/or
+// certificate-fingerprint pinning as requested.
+func makeClient(insecure bool, clientCert, clientKey, caCert, fingerprint string) (*http.Client, error) {
 	tr := &http.Transport{}
+	tlsConfig := &tls.Config{}
+
 	if insecure {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			return nil, fmt.Errorf("--client-cert and --client-key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if fingerprint != "" {
+		if caCert == "" {
+			// With no CA to chain-verify against, Go's TLS stack aborts the
+			// handshake before VerifyPeerCertificate ever runs, so pinning
+			// alone can't validate a self-signed server unless we skip the
+			// normal chain check here and enforce trust solely via the pin.
+			tlsConfig.InsecureSkipVerify = true
+		}
+		want := strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no server certificate presented")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			got := hex.EncodeToString(sum[:])
+			if got != want {
+				return fmt.Errorf("server certificate fingerprint %s does not match pinned %s", got, want)
+			}
+			return nil
+		}
 	}
-	return &http.Client{Timeout: 30 * time.Second, Transport: tr}
+
+	tr.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: 30 * time.Second, Transport: tr}, nil
 }
 
 func printResponse(status int, body []byte) {
@@ -176,7 +1301,7 @@ func printResponse(status int, body []byte) {
 	fmt.Println(string(body))
 }
 
-func pollStatus(client *http.Client, statusURL, token, cookie string) {
+func pollStatus(client *http.Client, statusURL, token, cookie, authScheme string, mtlsActive bool, headers map[string]string) {
 	fmt.Println("Polling status at:", statusURL)
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
@@ -186,7 +1311,8 @@ func pollStatus(client *http.Client, statusURL, token, cookie string) {
 		select {
 		case <-ticker.C:
 			req, _ := http.NewRequest("GET", statusURL, nil)
-			setAuth(req, token, cookie)
+			applyDefaultHeaders(req, headers)
+			setAuth(req, token, cookie, authScheme, mtlsActive)
 			resp, err := client.Do(req)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, "status request error:", err)
@@ -211,3 +1337,75 @@ func pollStatus(client *http.Client, statusURL, token, cookie string) {
 		}
 	}
 }
+
+// streamFrame is one message on the prefetch-stream WebSocket: a progress
+// tick, a log line, or the terminal result.
+type streamFrame struct {
+	Type   string `json:"type"`
+	Done   int    `json:"done,omitempty"`
+	Total  int    `json:"total,omitempty"`
+	Msg    string `json:"msg,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+// streamWebSocketReadLimit bounds a single frame; set well above the
+// default so large per-device diffs in "result" frames aren't truncated.
+const streamWebSocketReadLimit = 1 << 20 // 1 MiB
+
+// streamPrefetch subscribes to the prefetch-stream WebSocket for jobID and
+// prints frames as they arrive, returning as soon as a terminal "result"
+// frame is received or the socket closes. It reports handled=false (with no
+// error) when the server doesn't support streaming, so the caller can fall
+// back to HTTP polling.
+func streamPrefetch(client *http.Client, base, jobID, token, cookie, authScheme string, mtlsActive bool, headers map[string]string) (handled bool, err error) {
+	wsBase := strings.TrimRight(base, "/")
+	if strings.HasPrefix(wsBase, "https://") {
+		wsBase = "wss://" + strings.TrimPrefix(wsBase, "https://")
+	} else if strings.HasPrefix(wsBase, "http://") {
+		wsBase = "ws://" + strings.TrimPrefix(wsBase, "http://")
+	}
+	wsURL := wsBase + "/devices/audit/api/prefetch-stream/" + jobID + "/"
+
+	authReq, _ := http.NewRequest("GET", "/", nil)
+	applyDefaultHeaders(authReq, headers)
+	setAuth(authReq, token, cookie, authScheme, mtlsActive)
+	header := authReq.Header
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	fmt.Println("Streaming status at:", wsURL)
+	conn, resp, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{HTTPClient: client, HTTPHeader: header})
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUpgradeRequired) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(streamWebSocketReadLimit)
+
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return true, nil // socket closed; treat as job completion
+		}
+		var frame streamFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			fmt.Fprintln(os.Stderr, "received malformed frame:", err)
+			continue
+		}
+		switch frame.Type {
+		case "progress":
+			fmt.Printf("progress: %d/%d\n", frame.Done, frame.Total)
+		case "log":
+			fmt.Println("log:", frame.Msg)
+		case "result":
+			fmt.Println("Job finished with status:", frame.Status)
+			conn.Close(websocket.StatusNormalClosure, "")
+			return true, nil
+		default:
+			fmt.Println("frame:", string(data))
+		}
+	}
+}